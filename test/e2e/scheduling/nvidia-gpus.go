@@ -17,10 +17,16 @@ limitations under the License.
 package scheduling
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/uuid"
@@ -38,13 +44,40 @@ const (
 	testPodNamePrefix = "nvidia-gpu-"
 	// Nvidia driver installation can take upwards of 5 minutes.
 	driverInstallTimeout = 10 * time.Minute
+	// default amount of shared GPU memory (in MiB) requested by a single shared-GPU test pod.
+	sharedGPUMemoryPerPod = 1024
+	// node label the driver-installer DaemonSet sets once a driver version is installed.
+	nvidiaDriverVersionLabel = "nvidia.com/gpu-driver-version"
+	// driver migration can take as long as the initial install, plus time to drain.
+	driverUpgradeTimeout = 10 * time.Minute
+	// node label (set by Node Feature Discovery) that reports the GPU product name, e.g. "Tesla-T4".
+	gpuProductLabel = "nvidia.com/gpu.product"
+	// node label identifying nodes whose GPUs support MIG partitioning.
+	migCapableLabel = "nvidia.com/mig.capable"
+	// resource name prefix the device plugin uses to advertise MIG slices, e.g. "nvidia.com/mig-1g.5gb".
+	migResourceNamePrefix = "nvidia.com/mig-"
+	// configuring a MIG geometry and waiting for the device plugin to re-advertise it can take a few minutes.
+	migConfigTimeout = 5 * time.Minute
 )
 
 var (
 	gpuResourceName v1.ResourceName
 	dsYamlURL       string
+
+	sharedGPUResourceName v1.ResourceName
 )
 
+// NOTE(baetyl/k3s#chunk0-2): Dynamic Resource Allocation claim support for
+// GPU scheduling is explicitly descoped for this vendor tree, not merely
+// unimplemented. The DRA alpha surface (resource.k8s.io/v1alpha2 types,
+// v1.PodSpec.ResourceClaims, v1.ResourceRequirements.Claims, and the
+// context-taking ResourceV1alpha2() clientset methods it requires) was
+// introduced well after the client-go this repository vendors, which still
+// uses the no-context List/Create/Update signatures throughout this file.
+// There is no DRA API surface to build a test against at this vintage.
+// Revisit once the vendored client-go is upgraded past the pre-context
+// generation.
+
 func makeCudaAdditionDevicePluginTestPod() *v1.Pod {
 	podName := testPodNamePrefix + string(uuid.NewUUID())
 	testPod := &v1.Pod{
@@ -78,6 +111,173 @@ func makeCudaAdditionDevicePluginTestPod() *v1.Pod {
 	return testPod
 }
 
+// makeGPUHoldPod builds a pod that requests a whole GPU and then sleeps,
+// rather than running a one-shot CUDA workload, so it is still running when
+// a driver upgrade rolls through and can be observed being evicted or
+// rescheduled.
+func makeGPUHoldPod() *v1.Pod {
+	podName := testPodNamePrefix + "hold-" + string(uuid.NewUUID())
+	testPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: podName,
+		},
+		Spec: v1.PodSpec{
+			RestartPolicy: v1.RestartPolicyNever,
+			Containers: []v1.Container{
+				{
+					Name:    "gpu-hold",
+					Image:   imageutils.GetE2EImage(imageutils.CudaVectorAdd2),
+					Command: []string{"sleep", "3600"},
+					Resources: v1.ResourceRequirements{
+						Limits: v1.ResourceList{
+							gpuResourceName: *resource.NewQuantity(1, resource.DecimalSI),
+						},
+					},
+				},
+			},
+		},
+	}
+	return testPod
+}
+
+// makeCudaSharedGPUTestPod builds a pod that requests a fraction of a physical
+// GPU's memory through a share-capable device plugin resource (e.g.
+// aliyun.com/gpu-mem) instead of a whole nvidia.com/gpu device.
+func makeCudaSharedGPUTestPod(memoryMiB int64) *v1.Pod {
+	podName := testPodNamePrefix + string(uuid.NewUUID())
+	testPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: podName,
+		},
+		Spec: v1.PodSpec{
+			RestartPolicy: v1.RestartPolicyNever,
+			Containers: []v1.Container{
+				{
+					Name:  "vector-addition-cuda-shared",
+					Image: imageutils.GetE2EImage(imageutils.CudaVectorAdd2),
+					Resources: v1.ResourceRequirements{
+						Limits: v1.ResourceList{
+							sharedGPUResourceName: *resource.NewQuantity(memoryMiB, resource.DecimalSI),
+						},
+					},
+				},
+			},
+		},
+	}
+	return testPod
+}
+
+// makeCudaAdditionMIGTestPod builds a pod that requests a single MIG slice of
+// the given profile (e.g. "1g.5gb") instead of a whole nvidia.com/gpu device.
+func makeCudaAdditionMIGTestPod(profile string) *v1.Pod {
+	podName := testPodNamePrefix + string(uuid.NewUUID())
+	migResourceName := v1.ResourceName(migResourceNamePrefix + profile)
+	testPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: podName,
+		},
+		Spec: v1.PodSpec{
+			RestartPolicy: v1.RestartPolicyNever,
+			Containers: []v1.Container{
+				{
+					Name:  "vector-addition-cuda-mig",
+					Image: imageutils.GetE2EImage(imageutils.CudaVectorAdd2),
+					Resources: v1.ResourceRequirements{
+						Limits: v1.ResourceList{
+							migResourceName: *resource.NewQuantity(1, resource.DecimalSI),
+						},
+					},
+				},
+			},
+		},
+	}
+	return testPod
+}
+
+// buildMIGProfileList turns a slice count and MIG profile name into the
+// comma-separated profile list `nvidia-smi mig -cgi` expects, one entry per
+// GPU instance to create, e.g. buildMIGProfileList(7, "1g.5gb") produces
+// "1g.5gb,1g.5gb,1g.5gb,1g.5gb,1g.5gb,1g.5gb,1g.5gb".
+func buildMIGProfileList(sliceCount int, profile string) string {
+	profiles := make([]string, sliceCount)
+	for i := range profiles {
+		profiles[i] = profile
+	}
+	return strings.Join(profiles, ",")
+}
+
+// makeMIGConfigPod builds a privileged pod that runs on the given node and
+// invokes `nvidia-smi mig` to carve the node's GPU(s) into the instances
+// described by profileList (a comma-separated list as produced by
+// buildMIGProfileList). It requests a whole GPU and sets
+// NVIDIA_VISIBLE_DEVICES so the container toolkit injects the driver
+// libraries and nvidia-smi binary needed to run the command.
+func makeMIGConfigPod(nodeName, profileList string) *v1.Pod {
+	podName := "nvidia-mig-config-" + string(uuid.NewUUID())
+	privileged := true
+	testPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: podName,
+		},
+		Spec: v1.PodSpec{
+			RestartPolicy: v1.RestartPolicyNever,
+			NodeName:      nodeName,
+			HostPID:       true,
+			Containers: []v1.Container{
+				{
+					Name:    "configure-mig",
+					Image:   imageutils.GetE2EImage(imageutils.CudaVectorAdd2),
+					Command: []string{"nvidia-smi", "mig", "-cgi", profileList, "-C"},
+					Env: []v1.EnvVar{
+						{Name: "NVIDIA_VISIBLE_DEVICES", Value: "all"},
+					},
+					Resources: v1.ResourceRequirements{
+						Limits: v1.ResourceList{
+							gpuResourceName: *resource.NewQuantity(1, resource.DecimalSI),
+						},
+					},
+					SecurityContext: &v1.SecurityContext{
+						Privileged: &privileged,
+					},
+				},
+			},
+		},
+	}
+	return testPod
+}
+
+// makeGPUDetectorPod builds a short-lived pod that runs on the given node and
+// prints its GPU product name, for use when no NodeFeatureDiscovery label is
+// available to read the device type from.
+func makeGPUDetectorPod(nodeName string) *v1.Pod {
+	podName := "nvidia-gpu-detector-" + string(uuid.NewUUID())
+	testPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: podName,
+		},
+		Spec: v1.PodSpec{
+			RestartPolicy: v1.RestartPolicyNever,
+			NodeName:      nodeName,
+			Containers: []v1.Container{
+				{
+					Name:    "detect-gpu",
+					Image:   imageutils.GetE2EImage(imageutils.CudaVectorAdd2),
+					Command: []string{"nvidia-smi", "--query-gpu=name", "--format=csv,noheader"},
+					Env: []v1.EnvVar{
+						{Name: "NVIDIA_VISIBLE_DEVICES", Value: "all"},
+					},
+					Resources: v1.ResourceRequirements{
+						Limits: v1.ResourceList{
+							gpuResourceName: *resource.NewQuantity(1, resource.DecimalSI),
+						},
+					},
+				},
+			},
+		},
+	}
+	return testPod
+}
+
 func logOSImages(f *framework.Framework) {
 	nodeList, err := f.ClientSet.CoreV1().Nodes().List(metav1.ListOptions{})
 	framework.ExpectNoError(err, "getting node list")
@@ -116,6 +316,178 @@ func getGPUsAvailable(f *framework.Framework) int64 {
 	return gpusAvailable
 }
 
+// areMIGResourcesAvailable reports whether every schedulable, MIG-capable
+// node advertises a non-zero capacity for the given MIG profile (e.g.
+// "1g.5gb"), analogous to areGPUsAvailableOnAllSchedulableNodes.
+func areMIGResourcesAvailable(f *framework.Framework, profile string) bool {
+	migResourceName := v1.ResourceName(migResourceNamePrefix + profile)
+	nodeList, err := f.ClientSet.CoreV1().Nodes().List(metav1.ListOptions{})
+	framework.ExpectNoError(err, "getting node list")
+	for _, node := range nodeList.Items {
+		if node.Spec.Unschedulable || node.Labels[migCapableLabel] != "true" {
+			continue
+		}
+		if val, ok := node.Status.Capacity[migResourceName]; !ok || val.Value() == 0 {
+			e2elog.Logf("MIG profile %q not available on Node: %q", profile, node.Name)
+			return false
+		}
+	}
+	return true
+}
+
+// getMIGSlicesAvailable returns the total number of MIG slices of the given
+// profile reported as allocatable across all nodes, analogous to
+// getGPUsAvailable.
+func getMIGSlicesAvailable(f *framework.Framework, profile string) int64 {
+	migResourceName := v1.ResourceName(migResourceNamePrefix + profile)
+	nodeList, err := f.ClientSet.CoreV1().Nodes().List(metav1.ListOptions{})
+	framework.ExpectNoError(err, "getting node list")
+	var slicesAvailable int64
+	for _, node := range nodeList.Items {
+		if val, ok := node.Status.Allocatable[migResourceName]; ok {
+			slicesAvailable += (&val).Value()
+		}
+	}
+	return slicesAvailable
+}
+
+// getSharedGPUMemoryAvailable returns the total amount of shared GPU memory
+// (in the unit advertised by the shared-resource device plugin, e.g. MiB)
+// reported as allocatable across all nodes.
+func getSharedGPUMemoryAvailable(f *framework.Framework) int64 {
+	nodeList, err := f.ClientSet.CoreV1().Nodes().List(metav1.ListOptions{})
+	framework.ExpectNoError(err, "getting node list")
+	var memAvailable int64
+	for _, node := range nodeList.Items {
+		if val, ok := node.Status.Allocatable[sharedGPUResourceName]; ok {
+			memAvailable += (&val).Value()
+		}
+	}
+	return memAvailable
+}
+
+// gpuDriverFallbackEntry describes one candidate driver-installer DaemonSet
+// manifest for a range of GPU device types and driver major versions, as
+// configured through the GPU_DRIVER_FALLBACK_MAP env var.
+type gpuDriverFallbackEntry struct {
+	DeviceRegex string `json:"deviceRegex"`
+	MinMajor    int    `json:"minMajor"`
+	MaxMajor    int    `json:"maxMajor"`
+	DsYamlURL   string `json:"dsYamlURL"`
+}
+
+// detectGPUDeviceType returns the GPU product name (e.g. "Tesla-T4",
+// "A100-SXM4-40GB") for the cluster's nodes. It prefers the gpuProductLabel
+// on the first schedulable node that has it set (as populated by Node
+// Feature Discovery); if no node carries that label, it falls back to
+// running a short-lived detector pod against the first schedulable node.
+func detectGPUDeviceType(f *framework.Framework) (string, error) {
+	nodeList, err := f.ClientSet.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, node := range nodeList.Items {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		if deviceType, ok := node.Labels[gpuProductLabel]; ok && deviceType != "" {
+			return deviceType, nil
+		}
+	}
+
+	for _, node := range nodeList.Items {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		e2elog.Logf("No %q label found on any schedulable node; falling back to a detector pod on node %q", gpuProductLabel, node.Name)
+		return detectGPUDeviceTypeViaPod(f, node.Name)
+	}
+
+	return "", fmt.Errorf("no schedulable node found to detect GPU device type on")
+}
+
+// detectGPUDeviceTypeViaPod runs a short-lived pod on nodeName that queries
+// the node's GPU product name directly, for use when no NodeFeatureDiscovery
+// label is present.
+func detectGPUDeviceTypeViaPod(f *framework.Framework, nodeName string) (string, error) {
+	pod := f.PodClient().Create(makeGPUDetectorPod(nodeName))
+	f.PodClient().WaitForSuccess(pod.Name, 2*time.Minute)
+
+	logs, err := f.ClientSet.CoreV1().Pods(f.Namespace.Name).GetLogs(pod.Name, &v1.PodLogOptions{}).Do().Raw()
+	if err != nil {
+		return "", fmt.Errorf("fetching detector pod logs from node %q: %v", nodeName, err)
+	}
+	deviceType := strings.TrimSpace(string(logs))
+	if deviceType == "" {
+		return "", fmt.Errorf("detector pod on node %q produced no output", nodeName)
+	}
+	return deviceType, nil
+}
+
+// parseDriverMajorVersion extracts the leading major version number from a
+// driver version string such as "535.104.05".
+func parseDriverMajorVersion(version string) (int, error) {
+	major := strings.SplitN(version, ".", 2)[0]
+	return strconv.Atoi(major)
+}
+
+// resolveNVIDIADriverDaemonSetURL picks which driver-installer DaemonSet
+// manifest to install for the GPU type detected on the cluster's nodes. If
+// GPU_DRIVER_FALLBACK_MAP is unset, the primary manifest is always used. If
+// it's set, the primary manifest is kept only when its driver major version
+// falls within a fallback-map entry matching the detected device; otherwise
+// the first entry whose deviceRegex matches the detected device is used
+// instead.
+func resolveNVIDIADriverDaemonSetURL(f *framework.Framework, primaryDsYamlURL string) (string, error) {
+	fallbackMapJSON := os.Getenv("GPU_DRIVER_FALLBACK_MAP")
+	if fallbackMapJSON == "" {
+		return primaryDsYamlURL, nil
+	}
+
+	var fallbackMap []gpuDriverFallbackEntry
+	if err := json.Unmarshal([]byte(fallbackMapJSON), &fallbackMap); err != nil {
+		return "", fmt.Errorf("parsing GPU_DRIVER_FALLBACK_MAP: %v", err)
+	}
+
+	deviceType, err := detectGPUDeviceType(f)
+	if err != nil {
+		return "", fmt.Errorf("detecting GPU device type: %v", err)
+	}
+	e2elog.Logf("Detected GPU device type %q", deviceType)
+
+	primaryDs, err := framework.DsFromManifest(primaryDsYamlURL)
+	if err != nil {
+		return "", fmt.Errorf("loading primary driver-installer manifest %q: %v", primaryDsYamlURL, err)
+	}
+	primaryMajor, majorErr := parseDriverMajorVersion(primaryDs.Labels[nvidiaDriverVersionLabel])
+
+	var fallbackURL string
+	fallbackFound := false
+	for _, entry := range fallbackMap {
+		matched, err := regexp.MatchString(entry.DeviceRegex, deviceType)
+		if err != nil {
+			return "", fmt.Errorf("invalid deviceRegex %q: %v", entry.DeviceRegex, err)
+		}
+		if !matched {
+			continue
+		}
+		if majorErr == nil && primaryMajor >= entry.MinMajor && primaryMajor <= entry.MaxMajor {
+			e2elog.Logf("Primary driver-installer manifest %q (driver major %d) is compatible with %q", primaryDsYamlURL, primaryMajor, deviceType)
+			return primaryDsYamlURL, nil
+		}
+		if !fallbackFound {
+			fallbackURL = entry.DsYamlURL
+			fallbackFound = true
+		}
+	}
+	if fallbackFound {
+		e2elog.Logf("Falling back to driver-installer manifest %q for device %q", fallbackURL, deviceType)
+		return fallbackURL, nil
+	}
+
+	return "", fmt.Errorf("no entry in GPU_DRIVER_FALLBACK_MAP matches detected GPU device type %q", deviceType)
+}
+
 // SetupNVIDIAGPUNode install Nvidia Drivers and wait for Nvidia GPUs to be available on nodes
 func SetupNVIDIAGPUNode(f *framework.Framework, setupResourceGatherer bool) *framework.ContainerResourceGatherer {
 	logOSImages(f)
@@ -128,6 +500,10 @@ func SetupNVIDIAGPUNode(f *framework.Framework, setupResourceGatherer bool) *fra
 	}
 	gpuResourceName = gpu.NVIDIAGPUResourceName
 
+	resolvedDsYamlURL, err := resolveNVIDIADriverDaemonSetURL(f, dsYamlURL)
+	framework.ExpectNoError(err, "resolving driver-installer DaemonSet for detected GPU type")
+	dsYamlURL = resolvedDsYamlURL
+
 	e2elog.Logf("Using %v", dsYamlURL)
 	// Creates the DaemonSet that installs Nvidia Drivers.
 	ds, err := framework.DsFromManifest(dsYamlURL)
@@ -163,6 +539,104 @@ func SetupNVIDIAGPUNode(f *framework.Framework, setupResourceGatherer bool) *fra
 	return rsgather
 }
 
+// WaitForDriverVersion waits until every schedulable node is labeled with the
+// given Nvidia driver version, indicating the driver-installer DaemonSet has
+// finished (re)installing drivers on that node.
+func WaitForDriverVersion(f *framework.Framework, version string, timeout time.Duration) {
+	e2elog.Logf("Waiting for all schedulable nodes to report driver version %q", version)
+	gomega.Eventually(func() bool {
+		nodeList, err := f.ClientSet.CoreV1().Nodes().List(metav1.ListOptions{})
+		framework.ExpectNoError(err, "getting node list")
+		for _, node := range nodeList.Items {
+			if node.Spec.Unschedulable {
+				continue
+			}
+			if node.Labels[nvidiaDriverVersionLabel] != version {
+				e2elog.Logf("Node %q reports driver version %q, want %q", node.Name, node.Labels[nvidiaDriverVersionLabel], version)
+				return false
+			}
+		}
+		return true
+	}, timeout, time.Second).Should(gomega.BeTrue())
+}
+
+// UpgradeNVIDIADriverDaemonSet applies a new driver-installer DaemonSet
+// manifest (carrying a different driver version) over the one created by
+// SetupNVIDIAGPUNode, waits for the resulting rolling update to drain and
+// reinstall drivers on every node, and waits for GPUs to become available
+// again under the new driver version.
+func UpgradeNVIDIADriverDaemonSet(f *framework.Framework, upgradeDsYamlURL string, version string) {
+	e2elog.Logf("Using %v for driver upgrade", upgradeDsYamlURL)
+	upgradeDs, err := framework.DsFromManifest(upgradeDsYamlURL)
+	framework.ExpectNoError(err)
+
+	liveDs, err := f.ClientSet.AppsV1().DaemonSets(f.Namespace.Name).Get(upgradeDs.Name, metav1.GetOptions{})
+	framework.ExpectNoError(err, "failed to get live nvidia-driver-installer daemonset for upgrade")
+	liveDs.Spec = upgradeDs.Spec
+
+	_, err = f.ClientSet.AppsV1().DaemonSets(f.Namespace.Name).Update(liveDs)
+	framework.ExpectNoError(err, "failed to update nvidia-driver-installer daemonset for upgrade")
+	e2elog.Logf("Updated nvidia-driver-installer daemonset, waiting for rolling driver migration...")
+
+	e2elog.Logf("Waiting for GPU capacity to drop to zero while drivers are reinstalled...")
+	gomega.Eventually(func() bool {
+		return !areGPUsAvailableOnAllSchedulableNodes(f)
+	}, driverUpgradeTimeout, time.Second).Should(gomega.BeTrue())
+
+	WaitForDriverVersion(f, version, driverUpgradeTimeout)
+
+	e2elog.Logf("Waiting for GPUs to become available again under the upgraded driver...")
+	gomega.Eventually(func() bool {
+		return areGPUsAvailableOnAllSchedulableNodes(f)
+	}, driverUpgradeTimeout, time.Second).Should(gomega.BeTrue())
+}
+
+// SetupSharedGPUNode installs the Nvidia driver DaemonSet, waits for the pods
+// of the share-capable GPU device plugin DaemonSet (one that advertises a
+// fractional resource such as aliyun.com/gpu-mem, keyed off the physical
+// GPU's NVML-reported memory) named nvidia-shared-gpu-device-plugin in
+// kube-system, and waits for the shared resource to show up in node
+// allocatable. It does not create the device plugin DaemonSet; that
+// DaemonSet must already exist.
+func SetupSharedGPUNode(f *framework.Framework) {
+	logOSImages(f)
+
+	dsYamlURLFromEnv := os.Getenv("NVIDIA_DRIVER_INSTALLER_DAEMONSET")
+	if dsYamlURLFromEnv != "" {
+		dsYamlURL = dsYamlURLFromEnv
+	} else {
+		dsYamlURL = "https://raw.githubusercontent.com/GoogleCloudPlatform/container-engine-accelerators/master/daemonset.yaml"
+	}
+
+	sharedResourceNameFromEnv := os.Getenv("GPU_SHARED_RESOURCE_NAME")
+	if sharedResourceNameFromEnv != "" {
+		sharedGPUResourceName = v1.ResourceName(sharedResourceNameFromEnv)
+	} else {
+		sharedGPUResourceName = v1.ResourceName("aliyun.com/gpu-mem")
+	}
+
+	e2elog.Logf("Using %v", dsYamlURL)
+	// Creates the DaemonSet that installs Nvidia drivers.
+	ds, err := framework.DsFromManifest(dsYamlURL)
+	framework.ExpectNoError(err)
+	ds.Namespace = f.Namespace.Name
+	_, err = f.ClientSet.AppsV1().DaemonSets(f.Namespace.Name).Create(ds)
+	framework.ExpectNoError(err, "failed to create nvidia-driver-installer daemonset")
+	e2elog.Logf("Successfully created daemonset to install Nvidia drivers.")
+
+	_, err = framework.WaitForControlledPods(f.ClientSet, ds.Namespace, ds.Name, extensionsinternal.Kind("DaemonSet"))
+	framework.ExpectNoError(err, "failed to get pods controlled by the nvidia-driver-installer daemonset")
+
+	sharedDevicepluginPods, err := framework.WaitForControlledPods(f.ClientSet, "kube-system", "nvidia-shared-gpu-device-plugin", extensionsinternal.Kind("DaemonSet"))
+	framework.ExpectNoError(err, "failed to get pods controlled by the shared-gpu device plugin daemonset")
+	e2elog.Logf("Found %d shared-GPU device plugin pods", len(sharedDevicepluginPods.Items))
+
+	e2elog.Logf("Waiting for shared GPU resource %q to be available in Node Allocatable...", sharedGPUResourceName)
+	gomega.Eventually(func() bool {
+		return getSharedGPUMemoryAvailable(f) > 0
+	}, driverInstallTimeout, time.Second).Should(gomega.BeTrue())
+}
+
 func testNvidiaGPUs(f *framework.Framework) {
 	rsgather := SetupNVIDIAGPUNode(f, true)
 	e2elog.Logf("Creating as many pods as there are Nvidia GPUs and have the pods run a CUDA app")
@@ -184,9 +658,163 @@ func testNvidiaGPUs(f *framework.Framework) {
 	framework.ExpectNoError(err, "getting resource usage summary")
 }
 
+// testNvidiaSharedGPUs schedules multiple pods, each requesting a fraction of
+// a physical GPU's memory, onto shared GPU nodes and verifies that, per node,
+// the sum of shared GPU memory actually requested by co-scheduled pods never
+// exceeds the physical GPU memory NVML reported for that node (via
+// node.Status.Capacity, which the device plugin populates from NVML), and
+// that every pod's CUDA workload completes.
+func testNvidiaSharedGPUs(f *framework.Framework) {
+	SetupSharedGPUNode(f)
+
+	nodeList, err := f.ClientSet.CoreV1().Nodes().List(metav1.ListOptions{})
+	framework.ExpectNoError(err, "getting node list")
+
+	nodePhysicalMemory := make(map[string]int64)
+	var totalPodCount int64
+	for _, node := range nodeList.Items {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		val, ok := node.Status.Capacity[sharedGPUResourceName]
+		if !ok || val.Value() == 0 {
+			continue
+		}
+		nodePhysicalMemory[node.Name] = val.Value()
+		totalPodCount += val.Value() / sharedGPUMemoryPerPod
+	}
+	gomega.Expect(nodePhysicalMemory).NotTo(gomega.BeEmpty(), "no schedulable node reports NVML shared GPU memory capacity")
+	gomega.Expect(totalPodCount).To(gomega.BeNumerically(">", int64(0)), "no node's shared GPU memory capacity is large enough to host a %dMi test pod; cannot exercise co-scheduling", sharedGPUMemoryPerPod)
+
+	e2elog.Logf("Creating %d pods, each requesting %dMi of shared GPU memory", totalPodCount, sharedGPUMemoryPerPod)
+	podList := []*v1.Pod{}
+	for i := int64(0); i < totalPodCount; i++ {
+		podList = append(podList, f.PodClient().Create(makeCudaSharedGPUTestPod(sharedGPUMemoryPerPod)))
+	}
+
+	e2elog.Logf("Wait for all shared-GPU test pods to succeed")
+	for _, po := range podList {
+		f.PodClient().WaitForSuccess(po.Name, 5*time.Minute)
+	}
+
+	e2elog.Logf("Verifying per-node requested shared GPU memory never exceeded NVML-reported physical memory")
+	requestedPerNode := make(map[string]int64)
+	for _, po := range podList {
+		scheduledPod, err := f.ClientSet.CoreV1().Pods(f.Namespace.Name).Get(po.Name, metav1.GetOptions{})
+		framework.ExpectNoError(err, "getting scheduled shared-GPU test pod")
+		for _, c := range scheduledPod.Spec.Containers {
+			if qty, ok := c.Resources.Limits[sharedGPUResourceName]; ok {
+				requestedPerNode[scheduledPod.Spec.NodeName] += qty.Value()
+			}
+		}
+	}
+	for nodeName, requested := range requestedPerNode {
+		physicalMem, ok := nodePhysicalMemory[nodeName]
+		gomega.Expect(ok).To(gomega.BeTrue(), "node %q scheduled a shared-GPU pod but reports no NVML memory capacity", nodeName)
+		e2elog.Logf("Node %q: requested %dMi of %dMi physical shared GPU memory", nodeName, requested, physicalMem)
+		gomega.Expect(requested).To(gomega.BeNumerically("<=", physicalMem), "node %q over-committed shared GPU memory", nodeName)
+	}
+}
+
 var _ = SIGDescribe("[Feature:GPUDevicePlugin]", func() {
 	f := framework.NewDefaultFramework("device-plugin-gpus")
 	ginkgo.It("run Nvidia GPU Device Plugin tests", func() {
 		testNvidiaGPUs(f)
 	})
 })
+
+var _ = SIGDescribe("[Feature:GPUSharedDevicePlugin]", func() {
+	f := framework.NewDefaultFramework("shared-device-plugin-gpus")
+	ginkgo.It("run Nvidia shared-GPU Device Plugin tests", func() {
+		testNvidiaSharedGPUs(f)
+	})
+})
+
+// testNvidiaDriverUpgrade models the driver migration scenario: GPU pods are
+// running against the initially-installed driver, a second driver-installer
+// DaemonSet manifest carrying a different driver version is rolled out, and
+// the running pods are expected to be evicted or rescheduled rather than
+// left stranded, with a new CUDA pod succeeding once the upgrade completes.
+func testNvidiaDriverUpgrade(f *framework.Framework) {
+	SetupNVIDIAGPUNode(f, false)
+
+	e2elog.Logf("Creating a long-running pod to hold a GPU across the driver upgrade")
+	holdPod := f.PodClient().Create(makeGPUHoldPod())
+	err := framework.WaitForPodRunningInNamespace(f.ClientSet, holdPod)
+	framework.ExpectNoError(err, "waiting for GPU hold pod to start running")
+
+	upgradeDsYamlURL := os.Getenv("NVIDIA_DRIVER_INSTALLER_DAEMONSET_UPGRADE")
+	if upgradeDsYamlURL == "" {
+		framework.Failf("NVIDIA_DRIVER_INSTALLER_DAEMONSET_UPGRADE must be set to run the driver upgrade test")
+	}
+	upgradeDs, err := framework.DsFromManifest(upgradeDsYamlURL)
+	framework.ExpectNoError(err)
+	upgradeVersion := upgradeDs.Labels[nvidiaDriverVersionLabel]
+
+	UpgradeNVIDIADriverDaemonSet(f, upgradeDsYamlURL, upgradeVersion)
+
+	e2elog.Logf("Verifying the GPU hold pod was evicted/rescheduled rather than left stranded")
+	gomega.Eventually(func() bool {
+		p, err := f.ClientSet.CoreV1().Pods(f.Namespace.Name).Get(holdPod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true
+		}
+		framework.ExpectNoError(err, "getting GPU hold pod")
+		return p.UID != holdPod.UID || p.DeletionTimestamp != nil
+	}, driverUpgradeTimeout, time.Second).Should(gomega.BeTrue(), "expected the GPU hold pod to be evicted or rescheduled during the driver upgrade, not left stranded")
+
+	e2elog.Logf("Creating a new CUDA pod against the upgraded driver")
+	newPod := f.PodClient().Create(makeCudaAdditionDevicePluginTestPod())
+	f.PodClient().WaitForSuccess(newPod.Name, 5*time.Minute)
+}
+
+var _ = SIGDescribe("[Feature:GPUDriverUpgrade]", func() {
+	f := framework.NewDefaultFramework("driver-upgrade-gpus")
+	ginkgo.It("run Nvidia GPU driver migration tests", func() {
+		testNvidiaDriverUpgrade(f)
+	})
+})
+
+// testNvidiaMIGGPUs configures a MIG geometry on MIG-capable nodes, waits for
+// the device plugin to re-advertise the resulting slices, and schedules one
+// CUDA vector-add pod per slice, asserting they all succeed concurrently.
+func testNvidiaMIGGPUs(f *framework.Framework, sliceCount int, profile string) {
+	SetupNVIDIAGPUNode(f, false)
+
+	nodeList, err := f.ClientSet.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: migCapableLabel + "=true"})
+	framework.ExpectNoError(err, "listing MIG-capable nodes")
+	if len(nodeList.Items) == 0 {
+		framework.Failf("no nodes labeled %q=true found to run the MIG test", migCapableLabel)
+	}
+
+	profileList := buildMIGProfileList(sliceCount, profile)
+	e2elog.Logf("Configuring MIG geometry %q on %d MIG-capable node(s)", profileList, len(nodeList.Items))
+	for _, node := range nodeList.Items {
+		configPod := f.PodClient().Create(makeMIGConfigPod(node.Name, profileList))
+		f.PodClient().WaitForSuccess(configPod.Name, 5*time.Minute)
+	}
+
+	e2elog.Logf("Waiting for the device plugin to advertise MIG profile %q", profile)
+	gomega.Eventually(func() bool {
+		return areMIGResourcesAvailable(f, profile)
+	}, migConfigTimeout, time.Second).Should(gomega.BeTrue())
+
+	availableSlices := getMIGSlicesAvailable(f, profile)
+	e2elog.Logf("Creating %d pods, one per available MIG slice of profile %q", availableSlices, profile)
+	podList := []*v1.Pod{}
+	for i := int64(0); i < availableSlices; i++ {
+		podList = append(podList, f.PodClient().Create(makeCudaAdditionMIGTestPod(profile)))
+	}
+
+	e2elog.Logf("Wait for all MIG test pods to succeed concurrently")
+	for _, po := range podList {
+		f.PodClient().WaitForSuccess(po.Name, 5*time.Minute)
+	}
+}
+
+var _ = SIGDescribe("[Feature:MIGDevicePlugin]", func() {
+	f := framework.NewDefaultFramework("mig-device-plugin-gpus")
+	ginkgo.It("run Nvidia MIG GPU Device Plugin tests", func() {
+		testNvidiaMIGGPUs(f, 7, "1g.5gb")
+	})
+})